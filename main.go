@@ -0,0 +1,120 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/oauth2l/sgauth"
+	"github.com/google/oauth2l/util"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(1)
+	}
+	command := os.Args[1]
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	credentialsFile := fs.String("credentials_file", "", "Path to a credentials JSON file")
+	email := fs.String("email", "", "Email address to use for SSO fetch")
+	scope := fs.String("scope", "", "Space-separated list of OAuth scopes")
+	sts := fs.Bool("sts", false, "Exchange the fetched token via STS before returning it")
+	clientId := fs.String("client_id", "", "OAuth2 client ID, used by the fetch task's provider and PKCE flows")
+	clientSecret := fs.String("client_secret", "", "OAuth2 client secret, used by the fetch task's provider authorization code flow")
+	format := fs.String("output_format", "bare", "bare, header, json, json_compact, or pretty")
+	curlCli := fs.String("curl_cli", "curl", "curl binary to invoke for the curl task")
+	ssoCli := fs.String("sso_cli", "", "SSO CLI override for the SSO fallback")
+	deviceAuthURL := fs.String("device_auth_url", "", "Device authorization endpoint for the device task")
+	deviceTokenURL := fs.String("device_token_url", "", "Token endpoint used to poll for the device task")
+	deviceClientID := fs.String("device_client_id", "", "Client ID for the device task")
+	interactive := fs.Bool("interactive", false, "Allow an executable-sourced external_account credential to prompt interactively")
+	introspectURL := fs.String("introspect_url", "", "RFC 7662 introspection endpoint for the info and test tasks")
+	introspectClientID := fs.String("introspect_client_id", "", "Client ID used to authenticate to introspect_url")
+	introspectClientSecret := fs.String("introspect_client_secret", "", "Client secret used to authenticate to introspect_url")
+	introspectAuthStyle := fs.String("introspect_auth_style", "", "\"basic\" or \"params\"")
+	requiredScope := fs.String("required_scope", "", "Scope the test task requires the token to carry")
+	requiredAudience := fs.String("required_audience", "", "Audience the test task requires the token to carry")
+	provider := fs.String("provider", "", "Built-in provider preset: github, bitbucket, gitlab, azure, microsoft, okta, or slack")
+	flowType := fs.String("type", "", "\"pkce\" to use the PKCE authorization-code flow for the fetch task")
+	fs.Parse(os.Args[2:])
+
+	settings := &sgauth.Settings{
+		Email:    *email,
+		Scope:    *scope,
+		Sts:      *sts,
+		ClientId: *clientId,
+	}
+	if *credentialsFile != "" {
+		data, err := ioutil.ReadFile(*credentialsFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		settings.CredentialsJSON = string(data)
+	}
+
+	taskSettings := &util.TaskSettings{
+		Format:                 *format,
+		CurlCli:                *curlCli,
+		SsoCli:                 *ssoCli,
+		DeviceAuthURL:          *deviceAuthURL,
+		DeviceTokenURL:         *deviceTokenURL,
+		DeviceClientID:         *deviceClientID,
+		InteractiveMode:        *interactive,
+		IntrospectURL:          *introspectURL,
+		IntrospectClientID:     *introspectClientID,
+		IntrospectClientSecret: *introspectClientSecret,
+		IntrospectAuthStyle:    *introspectAuthStyle,
+		RequiredScope:          *requiredScope,
+		RequiredAudience:       *requiredAudience,
+		Provider:               *provider,
+		ClientSecret:           *clientSecret,
+	}
+
+	switch command {
+	case "fetch":
+		if *flowType == "pkce" {
+			util.Pkce(settings, taskSettings)
+		} else {
+			util.Fetch(settings, taskSettings)
+		}
+	case "header":
+		util.Header(settings, taskSettings)
+	case "curl":
+		taskSettings.Url = fs.Arg(0)
+		taskSettings.ExtraArgs = fs.Args()[1:]
+		util.Curl(settings, taskSettings)
+	case "info":
+		os.Exit(util.Info(fs.Arg(0), taskSettings))
+	case "test":
+		os.Exit(util.Test(fs.Arg(0), taskSettings))
+	case "reset":
+		util.Reset()
+	case "device":
+		util.Device(settings, taskSettings)
+	default:
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: oauth2l <fetch|header|curl|info|test|reset|device> [flags] [args]")
+}
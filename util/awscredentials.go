@@ -0,0 +1,263 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// awsCredentialSource configures the EC2/EKS instance metadata service
+// used to obtain AWS security credentials for the subject token exchange.
+// All fields are optional and default to the standard IMDSv2 endpoints.
+type awsCredentialSource struct {
+	RegionURL              string `json:"region_url"`
+	URL                    string `json:"url"`
+	IMDSv2SessionTokenURL  string `json:"imdsv2_session_token_url"`
+}
+
+const (
+	defaultAwsImdsTokenURL  = "http://169.254.169.254/latest/api/token"
+	defaultAwsRegionURL     = "http://169.254.169.254/latest/meta-data/placement/region"
+	defaultAwsMetadataURL   = "http://169.254.169.254/latest/meta-data/iam/security-credentials/"
+	awsImdsTokenHeader      = "X-aws-ec2-metadata-token"
+	awsImdsTokenTTLHeader   = "X-aws-ec2-metadata-token-ttl-seconds"
+	awsImdsTokenTTLSeconds  = "300"
+	awsRequestSigningAlgo   = "AWS4-HMAC-SHA256"
+	awsService              = "sts"
+)
+
+// awsSecurityCredentials is the JSON shape returned by the IMDSv2
+// security-credentials endpoint for a given role.
+type awsSecurityCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+// signedRequestHeader mirrors the {key, value} header shape Google's
+// AWS subject token format expects.
+type signedRequestHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// awsSubjectToken is the JSON blob Google's STS expects as the subject
+// token when exchanging AWS credentials: a serialized, SigV4-signed
+// GetCallerIdentity request that STS can replay to verify the caller's
+// AWS identity without ever seeing the long-term AWS credentials.
+type awsSubjectToken struct {
+	URL     string                 `json:"url"`
+	Method  string                 `json:"method"`
+	Headers []signedRequestHeader  `json:"headers"`
+}
+
+// subjectTokenFromAws obtains the instance's AWS role credentials from the
+// IMDSv2 metadata service and returns a signed GetCallerIdentity request,
+// serialized as JSON, suitable for use as an STS subject token.
+func subjectTokenFromAws(source *awsCredentialSource, audience string) (string, error) {
+	imdsToken, err := fetchAwsImdsToken(source)
+	if err != nil {
+		return "", err
+	}
+	region, err := fetchAwsRegion(source, imdsToken)
+	if err != nil {
+		return "", err
+	}
+	creds, err := fetchAwsSecurityCredentials(source, imdsToken)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := signAwsGetCallerIdentity(region, creds, audience)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func fetchAwsImdsToken(source *awsCredentialSource) (string, error) {
+	tokenURL := source.IMDSv2SessionTokenURL
+	if tokenURL == "" {
+		tokenURL = defaultAwsImdsTokenURL
+	}
+	req, err := http.NewRequest(http.MethodPut, tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(awsImdsTokenTTLHeader, awsImdsTokenTTLSeconds)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", errors.New(string(data))
+	}
+	return string(data), nil
+}
+
+func fetchAwsRegion(source *awsCredentialSource, imdsToken string) (string, error) {
+	regionURL := source.RegionURL
+	if regionURL == "" {
+		regionURL = defaultAwsRegionURL
+	}
+	data, err := getAwsMetadata(regionURL, imdsToken)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func fetchAwsSecurityCredentials(source *awsCredentialSource, imdsToken string) (*awsSecurityCredentials, error) {
+	metadataURL := source.URL
+	if metadataURL == "" {
+		metadataURL = defaultAwsMetadataURL
+	}
+	roleName, err := getAwsMetadata(metadataURL, imdsToken)
+	if err != nil {
+		return nil, err
+	}
+	data, err := getAwsMetadata(metadataURL+string(roleName), imdsToken)
+	if err != nil {
+		return nil, err
+	}
+	creds := &awsSecurityCredentials{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func getAwsMetadata(metadataURL string, imdsToken string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(awsImdsTokenHeader, imdsToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(string(data))
+	}
+	return data, nil
+}
+
+// signAwsGetCallerIdentity builds and SigV4-signs a GetCallerIdentity
+// request against the regional STS endpoint, binding it to audience via
+// the x-goog-cloud-target-resource header as Google's STS expects.
+func signAwsGetCallerIdentity(region string, creds *awsSecurityCredentials, audience string) (*awsSubjectToken, error) {
+	host := fmt.Sprintf("sts.%s.amazonaws.com", region)
+	requestURL := fmt.Sprintf("https://%s?Action=GetCallerIdentity&Version=2011-06-15", host)
+	now := awsSigningTime()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+
+	headers := map[string]string{
+		"host":                         host,
+		"x-amz-date":                   amzDate,
+		"x-goog-cloud-target-resource": audience,
+	}
+	if creds.Token != "" {
+		headers["x-amz-security-token"] = creds.Token
+	}
+
+	canonicalHeaders, signedHeaders := canonicalizeAwsHeaders(headers)
+	canonicalRequest := fmt.Sprintf("GET\n/\nAction=GetCallerIdentity&Version=2011-06-15\n%s\n%s\n%s",
+		canonicalHeaders, signedHeaders, sha256Hex(""))
+
+	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", dateStamp, region, awsService)
+	stringToSign := fmt.Sprintf("%s\n%s\n%s\n%s",
+		awsRequestSigningAlgo, amzDate, credentialScope, sha256Hex(canonicalRequest))
+
+	signingKey := awsSigningKey(creds.SecretAccessKey, dateStamp, region, awsService)
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+
+	authorization := fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsRequestSigningAlgo, creds.AccessKeyID, credentialScope, signedHeaders, signature)
+
+	headers["authorization"] = authorization
+
+	token := &awsSubjectToken{
+		URL:    requestURL,
+		Method: http.MethodGet,
+	}
+	for key, value := range headers {
+		token.Headers = append(token.Headers, signedRequestHeader{Key: key, Value: value})
+	}
+	return token, nil
+}
+
+// canonicalizeAwsHeaders returns the canonical headers block and the
+// semicolon-delimited signed headers list, both sorted by header name as
+// SigV4 requires. Header names are already lower-cased by the caller.
+func canonicalizeAwsHeaders(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonical := ""
+	for _, name := range names {
+		canonical += name + ":" + headers[name] + "\n"
+	}
+	return canonical, strings.Join(names, ";")
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func awsSigningKey(secretAccessKey, dateStamp, region, service string) []byte {
+	kDate := hmacSha256([]byte("AWS4"+secretAccessKey), dateStamp)
+	kRegion := hmacSha256(kDate, region)
+	kService := hmacSha256(kRegion, service)
+	return hmacSha256(kService, "aws4_request")
+}
+
+// awsSigningTime is a seam over time.Now so tests can fix the clock.
+var awsSigningTime = time.Now
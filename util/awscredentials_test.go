@@ -0,0 +1,89 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCanonicalizeAwsHeaders(t *testing.T) {
+	headers := map[string]string{
+		"x-amz-date": "20200101T120000Z",
+		"host":       "sts.us-east-1.amazonaws.com",
+	}
+	canonical, signedHeaders := canonicalizeAwsHeaders(headers)
+
+	wantCanonical := "host:sts.us-east-1.amazonaws.com\nx-amz-date:20200101T120000Z\n"
+	if canonical != wantCanonical {
+		t.Errorf("canonicalizeAwsHeaders() canonical = %q, want %q", canonical, wantCanonical)
+	}
+	wantSignedHeaders := "host;x-amz-date"
+	if signedHeaders != wantSignedHeaders {
+		t.Errorf("canonicalizeAwsHeaders() signedHeaders = %q, want %q", signedHeaders, wantSignedHeaders)
+	}
+}
+
+func TestSignAwsGetCallerIdentity(t *testing.T) {
+	original := awsSigningTime
+	awsSigningTime = func() time.Time {
+		return time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	}
+	defer func() { awsSigningTime = original }()
+
+	creds := &awsSecurityCredentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Token:           "TOKEN",
+	}
+	audience := "//iam.googleapis.com/projects/p/locations/global/workloadIdentityPools/pool/providers/provider"
+
+	token, err := signAwsGetCallerIdentity("us-east-1", creds, audience)
+	if err != nil {
+		t.Fatalf("signAwsGetCallerIdentity() error = %v", err)
+	}
+
+	if token.Method != http.MethodGet {
+		t.Errorf("Method = %q, want %q", token.Method, http.MethodGet)
+	}
+	wantURL := "https://sts.us-east-1.amazonaws.com?Action=GetCallerIdentity&Version=2011-06-15"
+	if token.URL != wantURL {
+		t.Errorf("URL = %q, want %q", token.URL, wantURL)
+	}
+
+	headerValue := func(key string) (string, bool) {
+		for _, h := range token.Headers {
+			if h.Key == key {
+				return h.Value, true
+			}
+		}
+		return "", false
+	}
+
+	if v, ok := headerValue("x-amz-security-token"); !ok || v != "TOKEN" {
+		t.Errorf("x-amz-security-token header = %q, %v; want %q", v, ok, "TOKEN")
+	}
+	if v, ok := headerValue("x-goog-cloud-target-resource"); !ok || v != audience {
+		t.Errorf("x-goog-cloud-target-resource header = %q, %v; want %q", v, ok, audience)
+	}
+
+	wantAuthorization := "AWS4-HMAC-SHA256 Credential=AKID/20200101/us-east-1/sts/aws4_request, " +
+		"SignedHeaders=host;x-amz-date;x-amz-security-token;x-goog-cloud-target-resource, " +
+		"Signature=2b36b17e7272e13571372f3f82525729b4e715f1aa6e57c1366eda3c5bbbfcf6"
+	if v, ok := headerValue("authorization"); !ok || v != wantAuthorization {
+		t.Errorf("authorization header =\n  %q\nwant\n  %q", v, wantAuthorization)
+	}
+}
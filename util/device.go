@@ -0,0 +1,200 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/google/oauth2l/sgauth"
+)
+
+// Grant type used when polling the token endpoint as part of the
+// Device Authorization Grant, per RFC 8628 section 3.4.
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Error codes the token endpoint may return while the user has not
+// yet finished authorizing the device, per RFC 8628 section 3.5.
+const (
+	deviceErrorAuthorizationPending = "authorization_pending"
+	deviceErrorSlowDown             = "slow_down"
+	deviceErrorAccessDenied         = "access_denied"
+	deviceErrorExpiredToken         = "expired_token"
+)
+
+// deviceAuthorizationResponse is the response of the device authorization
+// endpoint, per RFC 8628 section 3.2.
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// deviceErrorResponse is the error shape returned by the token endpoint
+// while polling, per RFC 8628 section 3.5.
+type deviceErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Device runs the OAuth 2.0 Device Authorization Grant (RFC 8628) flow,
+// suitable for headless environments such as SSH sessions, CI, and IoT
+// devices that cannot host a browser-based redirect. It prints the user
+// code and verification URL to stderr, polls the token endpoint until the
+// user authorizes the request, and prints the resulting token with the
+// given settings. STS exchange and caching happen the same way as for the
+// other tasks.
+func Device(settings *sgauth.Settings, taskSettings *TaskSettings) {
+	token := fetchDeviceToken(settings, taskSettings)
+	printToken(token, taskSettings.Format, getCredentialType(settings), providerName(taskSettings))
+}
+
+func fetchDeviceToken(settings *sgauth.Settings, taskSettings *TaskSettings) *sgauth.Token {
+	token, err := LookupCache(cacheKeySettings(settings, taskSettings))
+	if token != nil {
+		return token
+	}
+
+	applyProviderDeviceEndpoints(taskSettings)
+
+	authResp, err := requestDeviceAuthorization(settings, taskSettings)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	verificationURI := authResp.VerificationURIComplete
+	if verificationURI == "" {
+		verificationURI = authResp.VerificationURI
+	}
+	fmt.Fprintf(os.Stderr, "To authorize this request, visit:\n\n  %s\n\nand enter code: %s\n",
+		verificationURI, authResp.UserCode)
+
+	token, err = pollDeviceToken(taskSettings, authResp)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	if settings.Sts {
+		token, err = StsExchange(token.AccessToken, EncodeClaims(settings))
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+	}
+	err = InsertCache(cacheKeySettings(settings, taskSettings), token)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return token
+}
+
+func requestDeviceAuthorization(settings *sgauth.Settings, taskSettings *TaskSettings) (*deviceAuthorizationResponse, error) {
+	values := url.Values{
+		"client_id": {taskSettings.DeviceClientID},
+		"scope":     {settings.Scope},
+	}
+	resp, err := http.PostForm(taskSettings.DeviceAuthURL, values)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(string(data))
+	}
+	authResp := &deviceAuthorizationResponse{}
+	if err := json.Unmarshal(data, authResp); err != nil {
+		return nil, err
+	}
+	return authResp, nil
+}
+
+// pollDeviceToken polls the token endpoint at the interval returned by the
+// device authorization endpoint until the user finishes authorizing the
+// request, the device code expires, or the request is denied.
+func pollDeviceToken(taskSettings *TaskSettings, authResp *deviceAuthorizationResponse) (*sgauth.Token, error) {
+	interval := time.Duration(authResp.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expiresIn := authResp.ExpiresIn
+	if expiresIn <= 0 {
+		// RFC 8628 doesn't require expires_in to be populated; 1800
+		// seconds (30 minutes) matches the lifetime most providers use
+		// by default and keeps a zero/omitted value from producing a
+		// deadline in the past, which would skip polling altogether.
+		expiresIn = 1800
+	}
+	deadline := time.Now().Add(time.Duration(expiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		values := url.Values{
+			"client_id":   {taskSettings.DeviceClientID},
+			"device_code": {authResp.DeviceCode},
+			"grant_type":  {deviceGrantType},
+		}
+		resp, err := http.PostForm(taskSettings.DeviceTokenURL, values)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == 200 {
+			token := &sgauth.Token{}
+			if err := json.Unmarshal(data, token); err != nil {
+				return nil, err
+			}
+			return token, nil
+		}
+
+		errResp := &deviceErrorResponse{}
+		if err := json.Unmarshal(data, errResp); err != nil {
+			return nil, errors.New(string(data))
+		}
+		switch errResp.Error {
+		case deviceErrorAuthorizationPending:
+			continue
+		case deviceErrorSlowDown:
+			interval += 5 * time.Second
+		case deviceErrorAccessDenied:
+			return nil, errors.New("device authorization request was denied")
+		case deviceErrorExpiredToken:
+			return nil, errors.New("device code expired before authorization completed")
+		default:
+			return nil, errors.New(string(data))
+		}
+	}
+	return nil, errors.New("device authorization timed out")
+}
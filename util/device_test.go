@@ -0,0 +1,94 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPollDeviceTokenSucceedsAfterPending(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"authorization_pending"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"token123","token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+
+	taskSettings := &TaskSettings{DeviceTokenURL: server.URL, DeviceClientID: "client"}
+	// Use a short interval so the test doesn't wait on the 5s default.
+	authResp := &deviceAuthorizationResponse{DeviceCode: "devcode", Interval: 1, ExpiresIn: 0}
+
+	token, err := pollDeviceToken(taskSettings, authResp)
+	if err != nil {
+		t.Fatalf("pollDeviceToken() error = %v", err)
+	}
+	if token.AccessToken != "token123" {
+		t.Errorf("AccessToken = %q, want %q", token.AccessToken, "token123")
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+}
+
+func TestPollDeviceTokenAccessDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"access_denied"}`)
+	}))
+	defer server.Close()
+
+	taskSettings := &TaskSettings{DeviceTokenURL: server.URL, DeviceClientID: "client"}
+	authResp := &deviceAuthorizationResponse{DeviceCode: "devcode", Interval: 1, ExpiresIn: 10}
+
+	_, err := pollDeviceToken(taskSettings, authResp)
+	if err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("pollDeviceToken() error = %v, want an access_denied error", err)
+	}
+}
+
+func TestPollDeviceTokenDefaultsExpiresIn(t *testing.T) {
+	// expires_in omitted (0) must not produce a deadline in the past;
+	// the poll loop must run at least once instead of timing out
+	// immediately.
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		fmt.Fprint(w, `{"access_token":"token456","token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+
+	taskSettings := &TaskSettings{DeviceTokenURL: server.URL, DeviceClientID: "client"}
+	authResp := &deviceAuthorizationResponse{DeviceCode: "devcode", Interval: 1, ExpiresIn: 0}
+
+	token, err := pollDeviceToken(taskSettings, authResp)
+	if err != nil {
+		t.Fatalf("pollDeviceToken() error = %v", err)
+	}
+	if token.AccessToken != "token456" {
+		t.Errorf("AccessToken = %q, want %q", token.AccessToken, "token456")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
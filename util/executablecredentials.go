@@ -0,0 +1,148 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// allowExecutablesEnvVar gates running a credential_source.executable at
+// all, matching Google's Pluggable Auth security model of never invoking
+// an arbitrary binary without the caller explicitly opting in.
+const allowExecutablesEnvVar = "GOOGLE_EXTERNAL_ACCOUNT_ALLOW_EXECUTABLES"
+
+// Environment variables passed to the executable, per the Pluggable Auth
+// spec, so it can produce a token scoped to this exchange.
+const (
+	envSubjectTokenAudience = "GOOGLE_EXTERNAL_ACCOUNT_AUDIENCE"
+	envSubjectTokenType     = "GOOGLE_EXTERNAL_ACCOUNT_TOKEN_TYPE"
+	envInteractive          = "GOOGLE_EXTERNAL_ACCOUNT_INTERACTIVE"
+	envImpersonatedEmail    = "GOOGLE_EXTERNAL_ACCOUNT_IMPERSONATED_EMAIL"
+	envOutputFile           = "GOOGLE_EXTERNAL_ACCOUNT_OUTPUT_FILE"
+)
+
+const saml2SubjectTokenType = "urn:ietf:params:oauth:token-type:saml2"
+
+const defaultExecutableTimeout = 30 * time.Second
+
+// executableCredentialSource configures a pluggable auth executable that
+// produces the subject token on demand, per Google's Pluggable Auth spec.
+type executableCredentialSource struct {
+	Command       string `json:"command"`
+	TimeoutMillis int    `json:"timeout_millis"`
+	OutputFile    string `json:"output_file"`
+}
+
+// executableResponse is the JSON contract an executable credential must
+// print to stdout, or write to output_file.
+type executableResponse struct {
+	Version        int    `json:"version"`
+	Success        bool   `json:"success"`
+	TokenType      string `json:"token_type"`
+	IdToken        string `json:"id_token"`
+	SamlResponse   string `json:"saml_response"`
+	ExpirationTime int64  `json:"expiration_time"`
+	Code           string `json:"code"`
+	Message        string `json:"message"`
+}
+
+var impersonatedEmailPattern = regexp.MustCompile(`/serviceAccounts/([^:/]+):generateAccessToken$`)
+
+// subjectTokenFromExecutable runs the configured executable and returns
+// the subject token it produces.
+func subjectTokenFromExecutable(source *executableCredentialSource, creds *externalAccountCredentials, taskSettings *TaskSettings) (string, error) {
+	if os.Getenv(allowExecutablesEnvVar) != "1" {
+		return "", fmt.Errorf("credential_source.executable is configured but %s is not set to 1", allowExecutablesEnvVar)
+	}
+	// strings.Fields splits on whitespace only, so it can't express a
+	// quoted argument containing a space (e.g. a binary path with a
+	// space in it); command values that need that should be wrapped in
+	// a shell script instead.
+	args := strings.Fields(source.Command)
+	if len(args) == 0 {
+		return "", errors.New("credential_source.executable.command is required")
+	}
+
+	timeout := defaultExecutableTimeout
+	if source.TimeoutMillis > 0 {
+		timeout = time.Duration(source.TimeoutMillis) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		envSubjectTokenAudience+"="+creds.Audience,
+		envSubjectTokenType+"="+creds.SubjectTokenType,
+		envInteractive+"="+interactiveEnvValue(taskSettings.InteractiveMode),
+		envImpersonatedEmail+"="+impersonatedEmail(creds.ServiceAccountImpersonationURL),
+		envOutputFile+"="+source.OutputFile,
+	)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("executable credential failed: %v", err)
+	}
+
+	data := stdout.Bytes()
+	if len(bytes.TrimSpace(data)) == 0 && source.OutputFile != "" {
+		fileData, err := ioutil.ReadFile(source.OutputFile)
+		if err != nil {
+			return "", err
+		}
+		data = fileData
+	}
+
+	resp := &executableResponse{}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return "", err
+	}
+	if !resp.Success {
+		return "", fmt.Errorf("executable credential error %s: %s", resp.Code, resp.Message)
+	}
+	if resp.TokenType == saml2SubjectTokenType {
+		return resp.SamlResponse, nil
+	}
+	return resp.IdToken, nil
+}
+
+func interactiveEnvValue(interactive bool) string {
+	if interactive {
+		return "1"
+	}
+	return "0"
+}
+
+// impersonatedEmail extracts the service account email from a
+// service_account_impersonation_url, or "" if impersonation isn't used.
+func impersonatedEmail(impersonationURL string) string {
+	match := impersonatedEmailPattern.FindStringSubmatch(impersonationURL)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
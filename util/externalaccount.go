@@ -0,0 +1,257 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/google/oauth2l/sgauth"
+)
+
+// Credential type identifying a Workload Identity Federation credential,
+// as opposed to a service account or authorized user credential.
+const externalAccountCredentialType = "external_account"
+
+// credentialSourceFormat describes how to pull the subject token out of
+// the response of a file or url credential source.
+type credentialSourceFormat struct {
+	Type                  string `json:"type"`
+	SubjectTokenFieldName string `json:"subject_token_field_name"`
+}
+
+// credentialSource declares exactly one of file, url, aws, or executable
+// as the origin of the external subject token.
+type credentialSource struct {
+	File       string                       `json:"file"`
+	URL        string                       `json:"url"`
+	Headers    map[string]string            `json:"headers"`
+	Aws        *awsCredentialSource         `json:"aws"`
+	Executable *executableCredentialSource  `json:"executable"`
+	Format     credentialSourceFormat       `json:"format"`
+}
+
+// externalAccountCredentials is the subset of the Workload Identity
+// Federation credential JSON that oauth2l understands.
+type externalAccountCredentials struct {
+	Type                           string           `json:"type"`
+	Audience                       string           `json:"audience"`
+	SubjectTokenType               string           `json:"subject_token_type"`
+	TokenURL                       string           `json:"token_url"`
+	ServiceAccountImpersonationURL string           `json:"service_account_impersonation_url"`
+	CredentialSource               credentialSource `json:"credential_source"`
+}
+
+// parseExternalAccountCredentials parses credentialsJSON and reports
+// whether it describes an external_account credential. A nil result and
+// false is returned for any other credential type, including malformed
+// JSON, so callers can fall back to the regular sgauth path.
+func parseExternalAccountCredentials(credentialsJSON string) (*externalAccountCredentials, bool) {
+	creds := &externalAccountCredentials{}
+	if err := json.Unmarshal([]byte(credentialsJSON), creds); err != nil {
+		return nil, false
+	}
+	if creds.Type != externalAccountCredentialType {
+		return nil, false
+	}
+	return creds, true
+}
+
+// fetchExternalAccountToken performs the Workload Identity Federation
+// exchange: it obtains a subject token from the configured credential
+// source, exchanges it at the STS token_url for a federated access token,
+// and, if service_account_impersonation_url is set, swaps that for a
+// short-lived service account access token.
+func fetchExternalAccountToken(creds *externalAccountCredentials, settings *sgauth.Settings, taskSettings *TaskSettings) (*sgauth.Token, error) {
+	subjectToken, err := fetchSubjectToken(creds, taskSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := exchangeSubjectToken(creds, subjectToken, settings.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if creds.ServiceAccountImpersonationURL != "" {
+		token, err = impersonateServiceAccount(creds.ServiceAccountImpersonationURL, token.AccessToken, settings.Scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+func fetchSubjectToken(creds *externalAccountCredentials, taskSettings *TaskSettings) (string, error) {
+	source := creds.CredentialSource
+	switch {
+	case source.File != "":
+		return subjectTokenFromFile(source)
+	case source.URL != "":
+		return subjectTokenFromURL(source)
+	case source.Aws != nil:
+		return subjectTokenFromAws(source.Aws, creds.Audience)
+	case source.Executable != nil:
+		return subjectTokenFromExecutable(source.Executable, creds, taskSettings)
+	default:
+		return "", errors.New("credential_source must set one of file, url, aws, or executable")
+	}
+}
+
+func subjectTokenFromFile(source credentialSource) (string, error) {
+	data, err := ioutil.ReadFile(source.File)
+	if err != nil {
+		return "", err
+	}
+	return extractSubjectToken(data, source.Format)
+}
+
+func subjectTokenFromURL(source credentialSource) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, source.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range source.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", errors.New(string(data))
+	}
+	return extractSubjectToken(data, source.Format)
+}
+
+// extractSubjectToken returns data as-is unless format declares the
+// response as JSON, in which case the subject token is pulled out of the
+// field named by subject_token_field_name.
+func extractSubjectToken(data []byte, format credentialSourceFormat) (string, error) {
+	if format.Type != "json" {
+		return string(data), nil
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return "", err
+	}
+	value, ok := parsed[format.SubjectTokenFieldName].(string)
+	if !ok {
+		return "", fmt.Errorf("subject_token_field_name %q not found in credential source response", format.SubjectTokenFieldName)
+	}
+	return value, nil
+}
+
+// exchangeSubjectToken trades the subject token for a federated access
+// token at the STS token endpoint, per RFC 8693.
+func exchangeSubjectToken(creds *externalAccountCredentials, subjectToken string, scope string) (*sgauth.Token, error) {
+	values := url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {creds.Audience},
+		"subject_token_type":   {creds.SubjectTokenType},
+		"subject_token":        {subjectToken},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"scope":                {scope},
+	}
+	return postTokenRequest(creds.TokenURL, values)
+}
+
+// impersonateServiceAccount swaps accessToken for a short-lived access
+// token belonging to the service account fronted by impersonationURL.
+func impersonateServiceAccount(impersonationURL string, accessToken string, scope string) (*sgauth.Token, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"scope": []string{scope},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, impersonationURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(string(data))
+	}
+
+	// The IAM Credentials generateAccessToken response is
+	// {"accessToken": "...", "expireTime": "..."}, not the
+	// access_token/expires_in shape sgauth.Token decodes from the STS
+	// and sgauth.FetchToken responses, so it needs its own struct.
+	iamResp := &generateAccessTokenResponse{}
+	if err := json.Unmarshal(data, iamResp); err != nil {
+		return nil, err
+	}
+	if iamResp.AccessToken == "" {
+		return nil, errors.New(string(data))
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return &sgauth.Token{
+		AccessToken: iamResp.AccessToken,
+		TokenType:   "Bearer",
+		Raw:         raw,
+	}, nil
+}
+
+// generateAccessTokenResponse is the IAM Credentials API response shape
+// for projects.serviceAccounts.generateAccessToken, returned by
+// service_account_impersonation_url.
+type generateAccessTokenResponse struct {
+	AccessToken string `json:"accessToken"`
+	ExpireTime  string `json:"expireTime"`
+}
+
+func postTokenRequest(tokenURL string, values url.Values) (*sgauth.Token, error) {
+	resp, err := http.PostForm(tokenURL, values)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(string(data))
+	}
+	token := &sgauth.Token{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
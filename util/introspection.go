@@ -0,0 +1,128 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// introspectAuthStyleParams requests that client credentials be sent as
+// client_id/client_secret form parameters instead of HTTP Basic auth.
+const introspectAuthStyleParams = "params"
+
+// introspectionResponse is the RFC 7662 token introspection response.
+// Aud is kept raw since the spec allows either a single string or an
+// array of strings; use Audience to read it uniformly.
+type introspectionResponse struct {
+	Active    bool            `json:"active"`
+	Scope     string          `json:"scope"`
+	ClientID  string          `json:"client_id"`
+	Username  string          `json:"username"`
+	TokenType string          `json:"token_type"`
+	Exp       int64           `json:"exp"`
+	Iat       int64           `json:"iat"`
+	Nbf       int64           `json:"nbf"`
+	Sub       string          `json:"sub"`
+	Aud       json.RawMessage `json:"aud"`
+	Iss       string          `json:"iss"`
+	Jti       string          `json:"jti"`
+}
+
+// Audience normalizes the aud claim, which RFC 7662 allows to be either
+// a single string or an array of strings, into a slice.
+func (r *introspectionResponse) Audience() []string {
+	if len(r.Aud) == 0 {
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(r.Aud, &single); err == nil {
+		return []string{single}
+	}
+	var multiple []string
+	if err := json.Unmarshal(r.Aud, &multiple); err == nil {
+		return multiple
+	}
+	return nil
+}
+
+// introspectToken performs RFC 7662 token introspection against
+// taskSettings.IntrospectURL, authenticating with IntrospectClientID and
+// IntrospectClientSecret per IntrospectAuthStyle.
+func introspectToken(token string, taskSettings *TaskSettings) (*introspectionResponse, error) {
+	values := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+
+	useParamsAuth := taskSettings.IntrospectAuthStyle == introspectAuthStyleParams
+	if useParamsAuth {
+		values.Set("client_id", taskSettings.IntrospectClientID)
+		values.Set("client_secret", taskSettings.IntrospectClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, taskSettings.IntrospectURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if !useParamsAuth && taskSettings.IntrospectClientID != "" {
+		req.SetBasicAuth(taskSettings.IntrospectClientID, taskSettings.IntrospectClientSecret)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(string(data))
+	}
+
+	info := &introspectionResponse{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// hasScope reports whether requiredScope appears in the space-delimited
+// scope string, per RFC 7662 section 2.2.
+func hasScope(scope string, requiredScope string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == requiredScope {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAudience reports whether requiredAudience appears in aud.
+func hasAudience(aud []string, requiredAudience string) bool {
+	for _, a := range aud {
+		if a == requiredAudience {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import "testing"
+
+func TestHasScope(t *testing.T) {
+	cases := []struct {
+		scope         string
+		requiredScope string
+		want          bool
+	}{
+		{"read write", "read", true},
+		{"read write", "write", true},
+		{"read write", "admin", false},
+		{"", "read", false},
+	}
+	for _, c := range cases {
+		if got := hasScope(c.scope, c.requiredScope); got != c.want {
+			t.Errorf("hasScope(%q, %q) = %v, want %v", c.scope, c.requiredScope, got, c.want)
+		}
+	}
+}
+
+func TestHasAudience(t *testing.T) {
+	cases := []struct {
+		aud              []string
+		requiredAudience string
+		want             bool
+	}{
+		{[]string{"https://api.example.com"}, "https://api.example.com", true},
+		{[]string{"https://api.example.com", "https://other.example.com"}, "https://other.example.com", true},
+		{[]string{"https://api.example.com"}, "https://other.example.com", false},
+		{nil, "https://api.example.com", false},
+	}
+	for _, c := range cases {
+		if got := hasAudience(c.aud, c.requiredAudience); got != c.want {
+			t.Errorf("hasAudience(%v, %q) = %v, want %v", c.aud, c.requiredAudience, got, c.want)
+		}
+	}
+}
+
+func TestIntrospectionResponseAudienceSingleString(t *testing.T) {
+	resp := &introspectionResponse{Aud: []byte(`"https://api.example.com"`)}
+	got := resp.Audience()
+	if len(got) != 1 || got[0] != "https://api.example.com" {
+		t.Errorf("Audience() = %v, want [https://api.example.com]", got)
+	}
+}
+
+func TestIntrospectionResponseAudienceArray(t *testing.T) {
+	resp := &introspectionResponse{Aud: []byte(`["a", "b"]`)}
+	got := resp.Audience()
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Audience() = %v, want [a b]", got)
+	}
+}
@@ -0,0 +1,225 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+
+	"github.com/google/oauth2l/sgauth"
+)
+
+// Default Google endpoints used for the PKCE flow when taskSettings
+// doesn't select a non-Google provider.
+const (
+	googlePkceAuthURL  = "https://accounts.google.com/o/oauth2/v2/auth"
+	googlePkceTokenURL = "https://oauth2.googleapis.com/token"
+)
+
+const pkceCallbackPath = "/callback"
+
+// codeVerifierBytes produces a base64url-encoded verifier of 43
+// characters, the minimum allowed by RFC 7636 and enough entropy for the
+// 43-128 character range it requires.
+const codeVerifierBytes = 32
+
+// Pkce runs the OAuth 2.0 Authorization Code flow with PKCE (RFC 7636)
+// for installed-app scenarios where only a client_id is available, with
+// no client_secret to protect. It opens the user's browser to the
+// authorization endpoint, captures the redirect on an ephemeral loopback
+// listener, and exchanges the resulting code for a token. The resulting
+// token flows through the same cache/STS/print pipeline as the other
+// tasks.
+func Pkce(settings *sgauth.Settings, taskSettings *TaskSettings) {
+	token := fetchPkceToken(settings, taskSettings)
+	printToken(token, taskSettings.Format, getCredentialType(settings), providerName(taskSettings))
+}
+
+func fetchPkceToken(settings *sgauth.Settings, taskSettings *TaskSettings) *sgauth.Token {
+	token, err := LookupCache(cacheKeySettings(settings, taskSettings))
+	if token != nil {
+		return token
+	}
+
+	authURL, tokenURL := pkceEndpoints(taskSettings)
+
+	verifier, err := generateCodeVerifier()
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	challenge := codeChallengeS256(verifier)
+	state, err := generateCodeVerifier()
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	extraParams := url.Values{
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	code, redirectURI, err := requestAuthorizationCode(authURL, settings, state, extraParams)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	token, err = exchangePkceCode(tokenURL, settings.ClientId, code, verifier, redirectURI)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	if settings.Sts {
+		token, err = StsExchange(token.AccessToken, EncodeClaims(settings))
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+	}
+	err = InsertCache(cacheKeySettings(settings, taskSettings), token)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return token
+}
+
+func pkceEndpoints(taskSettings *TaskSettings) (authURL string, tokenURL string) {
+	if endpoints := resolveProviderEndpoints(taskSettings); endpoints != nil {
+		return endpoints.AuthURL, endpoints.TokenURL
+	}
+	return googlePkceAuthURL, googlePkceTokenURL
+}
+
+// generateCodeVerifier returns a cryptographically random, URL-safe
+// string suitable for use as a PKCE code_verifier or state value.
+func generateCodeVerifier() (string, error) {
+	raw := make([]byte, codeVerifierBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func codeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// requestAuthorizationCode spins up an ephemeral loopback HTTP server,
+// opens the user's browser to authURL with the given extraParams merged
+// into the query (e.g. PKCE's code_challenge), and blocks until the
+// authorization code arrives on the callback.
+func requestAuthorizationCode(authURL string, settings *sgauth.Settings, state string, extraParams url.Values) (code string, redirectURI string, err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", "", err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	redirectURI = fmt.Sprintf("http://127.0.0.1:%d%s", port, pkceCallbackPath)
+
+	type result struct {
+		code string
+		err  error
+	}
+	resultCh := make(chan result, 1)
+
+	mux := http.NewServeMux()
+	server := &http.Server{Handler: mux}
+	mux.HandleFunc(pkceCallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("state") != state {
+			resultCh <- result{err: errors.New("pkce callback received mismatched state")}
+		} else if errParam := query.Get("error"); errParam != "" {
+			resultCh <- result{err: fmt.Errorf("authorization failed: %s", errParam)}
+		} else {
+			resultCh <- result{code: query.Get("code")}
+		}
+		fmt.Fprint(w, "Authentication complete. You may close this window.")
+	})
+
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+
+	values := url.Values{
+		"response_type": {"code"},
+		"client_id":     {settings.ClientId},
+		"redirect_uri":  {redirectURI},
+		"scope":         {settings.Scope},
+		"state":         {state},
+	}
+	for key, vals := range extraParams {
+		values[key] = vals
+	}
+	fullAuthURL := authURL + "?" + values.Encode()
+	if err := openBrowser(fullAuthURL); err != nil {
+		fmt.Printf("Open the following URL in your browser:\n\n  %s\n\n", fullAuthURL)
+	}
+
+	res := <-resultCh
+	return res.code, redirectURI, res.err
+}
+
+func exchangePkceCode(tokenURL string, clientID string, code string, verifier string, redirectURI string) (*sgauth.Token, error) {
+	values := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {clientID},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirectURI},
+	}
+	resp, err := http.PostForm(tokenURL, values)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(string(data))
+	}
+	token := &sgauth.Token{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// openBrowser launches the system's default browser at the given URL.
+func openBrowser(targetURL string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", targetURL).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", targetURL).Start()
+	default:
+		return exec.Command("xdg-open", targetURL).Start()
+	}
+}
@@ -0,0 +1,46 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import "testing"
+
+func TestCodeChallengeS256(t *testing.T) {
+	// Fixed vector from RFC 7636 Appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	got := codeChallengeS256(verifier)
+	if got != want {
+		t.Errorf("codeChallengeS256(%q) = %q, want %q", verifier, got, want)
+	}
+}
+
+func TestGenerateCodeVerifier(t *testing.T) {
+	verifier, err := generateCodeVerifier()
+	if err != nil {
+		t.Fatalf("generateCodeVerifier() error = %v", err)
+	}
+	if len(verifier) < 43 {
+		t.Errorf("len(verifier) = %d, want at least 43 per RFC 7636", len(verifier))
+	}
+
+	other, err := generateCodeVerifier()
+	if err != nil {
+		t.Fatalf("generateCodeVerifier() error = %v", err)
+	}
+	if verifier == other {
+		t.Error("generateCodeVerifier() returned the same value twice")
+	}
+}
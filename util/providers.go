@@ -0,0 +1,152 @@
+//
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import "github.com/google/oauth2l/sgauth"
+
+// ProviderEndpoints describes the OAuth2 endpoints for a non-Google
+// identity provider, so Fetch/fetchToken aren't limited to Google's auth
+// and token URLs. AuthStyle selects how client credentials are sent to
+// TokenURL: "basic" for HTTP Basic auth, "params" for client_id/
+// client_secret as POST body parameters.
+type ProviderEndpoints struct {
+	Name          string
+	AuthURL       string
+	TokenURL      string
+	DeviceAuthURL string
+	RevokeURL     string
+	AuthStyle     string
+}
+
+// providerPresets holds the built-in endpoint configurations for common
+// OAuth2 providers, selectable via TaskSettings.Provider or --provider.
+// Providers with per-tenant domains (e.g. Okta) are left without fixed
+// URLs; callers must supply those via an explicit ProviderEndpoints
+// override.
+// Bitbucket, Okta, and Slack don't expose a fixed device-authorization
+// endpoint (Bitbucket and Slack don't implement RFC 8628 at all; Okta's
+// is per-tenant), so their presets leave DeviceAuthURL unset. Running the
+// Device task against one of those requires an explicit
+// --device_auth_url override.
+var providerPresets = map[string]*ProviderEndpoints{
+	"github": {
+		Name:          "github",
+		AuthURL:       "https://github.com/login/oauth/authorize",
+		TokenURL:      "https://github.com/login/oauth/access_token",
+		DeviceAuthURL: "https://github.com/login/device/code",
+		AuthStyle:     "params",
+	},
+	"bitbucket": {
+		Name:      "bitbucket",
+		AuthURL:   "https://bitbucket.org/site/oauth2/authorize",
+		TokenURL:  "https://bitbucket.org/site/oauth2/access_token",
+		AuthStyle: "basic",
+	},
+	"gitlab": {
+		Name:          "gitlab",
+		AuthURL:       "https://gitlab.com/oauth/authorize",
+		TokenURL:      "https://gitlab.com/oauth/token",
+		DeviceAuthURL: "https://gitlab.com/oauth/authorize_device",
+		AuthStyle:     "params",
+	},
+	"azure": {
+		Name:          "azure",
+		AuthURL:       "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		TokenURL:      "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		DeviceAuthURL: "https://login.microsoftonline.com/common/oauth2/v2.0/devicecode",
+		AuthStyle:     "params",
+	},
+	"microsoft": {
+		Name:          "microsoft",
+		AuthURL:       "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		TokenURL:      "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		DeviceAuthURL: "https://login.microsoftonline.com/common/oauth2/v2.0/devicecode",
+		AuthStyle:     "params",
+	},
+	"okta": {
+		Name:      "okta",
+		AuthStyle: "basic",
+	},
+	"slack": {
+		Name:      "slack",
+		AuthURL:   "https://slack.com/oauth/v2/authorize",
+		TokenURL:  "https://slack.com/api/oauth.v2.access",
+		AuthStyle: "params",
+	},
+}
+
+// resolveProviderEndpoints returns the effective provider endpoints for
+// taskSettings, or nil for the Google default. An explicit
+// ProviderEndpoints override always wins; otherwise Provider is looked
+// up in providerPresets.
+func resolveProviderEndpoints(taskSettings *TaskSettings) *ProviderEndpoints {
+	if taskSettings.ProviderEndpoints != nil {
+		return taskSettings.ProviderEndpoints
+	}
+	if taskSettings.Provider == "" {
+		return nil
+	}
+	return providerPresets[taskSettings.Provider]
+}
+
+// providerName returns the provider identifier to show in output and to
+// namespace the token cache, or "" for the Google default.
+func providerName(taskSettings *TaskSettings) string {
+	if endpoints := resolveProviderEndpoints(taskSettings); endpoints != nil {
+		return endpoints.Name
+	}
+	return taskSettings.Provider
+}
+
+// cacheKeySettings returns the *sgauth.Settings to pass to
+// LookupCache/InsertCache: for the Google default it's settings itself,
+// unchanged; for a configured provider it's a shallow copy namespaced by
+// the provider identifier, so a Google token and a --provider token
+// fetched with an otherwise-identical Settings don't collide in the
+// cache. The original settings must still be used for the actual network
+// requests — only the cache lookup/insert calls should see the copy.
+//
+// The namespace is folded into ClientId rather than Email: Email already
+// carries its own meaning elsewhere in fetchToken (it selects the SSO
+// path), so stamping a provider prefix onto it would make that copy's
+// Email look like a real SSO identity. ClientId has no such competing
+// meaning in this package. The provider prefix alone keeps the keys
+// apart, so the copy is namespaced even when ClientId is empty, as it can
+// be for the Device task, which takes its client ID from DeviceClientID.
+func cacheKeySettings(settings *sgauth.Settings, taskSettings *TaskSettings) *sgauth.Settings {
+	name := providerName(taskSettings)
+	if name == "" {
+		return settings
+	}
+	keyed := *settings
+	keyed.ClientId = name + ":" + keyed.ClientId
+	return &keyed
+}
+
+// applyProviderDeviceEndpoints fills in taskSettings.DeviceAuthURL and
+// DeviceTokenURL from the resolved provider preset, unless the caller has
+// already set them explicitly.
+func applyProviderDeviceEndpoints(taskSettings *TaskSettings) {
+	endpoints := resolveProviderEndpoints(taskSettings)
+	if endpoints == nil {
+		return
+	}
+	if taskSettings.DeviceAuthURL == "" {
+		taskSettings.DeviceAuthURL = endpoints.DeviceAuthURL
+	}
+	if taskSettings.DeviceTokenURL == "" {
+		taskSettings.DeviceTokenURL = endpoints.TokenURL
+	}
+}
@@ -55,13 +55,48 @@ type TaskSettings struct {
 	ExtraArgs []string
 	// SsoCli override for Sso task
 	SsoCli string
+	// Device authorization endpoint for Device task
+	DeviceAuthURL string
+	// Token endpoint used to poll for the device token
+	DeviceTokenURL string
+	// Client ID used to authorize the Device task
+	DeviceClientID string
+	// Whether an executable-sourced external_account credential may
+	// prompt the user interactively (e.g. open a browser)
+	InteractiveMode bool
+	// RFC 7662 introspection endpoint for Info/Test. If empty, Info/Test
+	// fall back to Google's tokeninfo endpoint.
+	IntrospectURL string
+	// Client credentials used to authenticate to IntrospectURL
+	IntrospectClientID     string
+	IntrospectClientSecret string
+	// How client credentials are sent to IntrospectURL: "basic" (HTTP
+	// Basic, the default) or "params" (client_id/client_secret in the
+	// POST body)
+	IntrospectAuthStyle string
+	// If set, Test additionally requires this scope to be present in
+	// the introspection response's scope list
+	RequiredScope string
+	// If set, Test additionally requires this audience to be present in
+	// the introspection response's aud claim
+	RequiredAudience string
+	// Name of a built-in provider preset (e.g. "github", "gitlab",
+	// "azure", "okta") to use instead of Google's endpoints
+	Provider string
+	// Full endpoint override for a non-Google provider; takes
+	// precedence over Provider when set
+	ProviderEndpoints *ProviderEndpoints
+	// Client secret for the plain fetch task's provider Authorization
+	// Code flow. Unused by Pkce, which targets public clients that have
+	// no secret to protect.
+	ClientSecret string
 }
 
 // Fetches and prints the token in plain text with the given settings
 // using Google Authenticator.
 func Fetch(settings *sgauth.Settings, taskSettings *TaskSettings) {
 	token := fetchToken(settings, taskSettings)
-	printToken(token, taskSettings.Format, getCredentialType(settings))
+	printToken(token, taskSettings.Format, getCredentialType(settings), providerName(taskSettings))
 }
 
 // Fetches and prints the token in header format with the given settings
@@ -84,9 +119,11 @@ func Curl(settings *sgauth.Settings, taskSettings *TaskSettings) {
 	}
 }
 
-// Fetches the information of the given token.
-func Info(token string) int {
-	info, err := getTokenInfo(token)
+// Fetches the information of the given token using the introspection
+// endpoint configured in taskSettings, or Google's tokeninfo endpoint if
+// none is configured.
+func Info(token string, taskSettings *TaskSettings) int {
+	info, err := getTokenInfo(token, taskSettings)
 	if err != nil {
 		fmt.Print(err)
 	} else {
@@ -97,15 +134,20 @@ func Info(token string) int {
 
 // Tests the given token. Returns 0 for valid tokens.
 // Otherwise returns 1.
-func Test(token string) int {
-	_, err := getTokenInfo(token)
-	if err != nil {
+//
+// When taskSettings configures an IntrospectURL, the token is considered
+// valid only when the introspection response reports active=true and, if
+// configured, RequiredScope/RequiredAudience are satisfied. Otherwise the
+// legacy behavior of treating any successful Google tokeninfo response as
+// valid is preserved.
+func Test(token string, taskSettings *TaskSettings) int {
+	active, err := isTokenActive(token, taskSettings)
+	if err != nil || !active {
 		fmt.Println(1)
 		return 1
-	} else {
-		fmt.Println(0)
-		return 0
 	}
+	fmt.Println(0)
+	return 0
 }
 
 // Resets the cache.
@@ -121,7 +163,27 @@ func BuildHeader(tokenType string, token string) string {
 	return fmt.Sprintf("Authorization: %s %s", tokenType, token)
 }
 
-func getTokenInfo(token string) (string, error) {
+// getTokenInfo returns token information as a string. If taskSettings
+// configures an IntrospectURL, it performs RFC 7662 token introspection
+// against that endpoint and returns the fields of introspectionResponse
+// re-encoded as JSON; fields outside that struct are dropped. Otherwise
+// it returns the raw response of Google's legacy tokeninfo endpoint.
+func getTokenInfo(token string, taskSettings *TaskSettings) (string, error) {
+	if taskSettings != nil && taskSettings.IntrospectURL != "" {
+		info, err := introspectToken(token, taskSettings)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(info)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return getGoogleTokenInfo(token)
+}
+
+func getGoogleTokenInfo(token string) (string, error) {
 	c := http.DefaultClient
 	resp, err := c.Get(googleTokenInfoURLPrefix + token)
 	if err != nil {
@@ -134,15 +196,45 @@ func getTokenInfo(token string) (string, error) {
 	return string(data), err
 }
 
+// isTokenActive reports whether token is currently valid. If taskSettings
+// configures an IntrospectURL, this performs RFC 7662 introspection and
+// additionally checks RequiredScope/RequiredAudience when set; otherwise
+// it falls back to the legacy behavior of treating a successful Google
+// tokeninfo response as valid.
+func isTokenActive(token string, taskSettings *TaskSettings) (bool, error) {
+	if taskSettings == nil || taskSettings.IntrospectURL == "" {
+		_, err := getGoogleTokenInfo(token)
+		return err == nil, err
+	}
+	info, err := introspectToken(token, taskSettings)
+	if err != nil {
+		return false, err
+	}
+	if !info.Active {
+		return false, nil
+	}
+	if taskSettings.RequiredScope != "" && !hasScope(info.Scope, taskSettings.RequiredScope) {
+		return false, nil
+	}
+	if taskSettings.RequiredAudience != "" && !hasAudience(info.Audience(), taskSettings.RequiredAudience) {
+		return false, nil
+	}
+	return true, nil
+}
+
 // fetchToken attempts to fetch and cache an access token.
 //
 // If CredentialsJSON is not provided, but email is provided,
 // attempt to obtain token via SSO instead of sgauth.
 //
+// If taskSettings resolves to a non-Google provider, the token is
+// fetched via that provider's own Authorization Code flow instead of
+// sgauth.FetchToken, which only knows how to talk to Google.
+//
 // If STS is requested, we will perform an STS exchange
 // after the original access token has been fetched.
 func fetchToken(settings *sgauth.Settings, taskSettings *TaskSettings) *sgauth.Token {
-	token, err := LookupCache(settings)
+	token, err := LookupCache(cacheKeySettings(settings, taskSettings))
 	if token == nil {
 		if settings.CredentialsJSON == "" && settings.Email != "" {
 			token, err = SSOFetch(taskSettings.SsoCli, settings.Email, settings.Scope)
@@ -150,6 +242,18 @@ func fetchToken(settings *sgauth.Settings, taskSettings *TaskSettings) *sgauth.T
 				fmt.Println(err)
 				return nil
 			}
+		} else if externalAccount, ok := parseExternalAccountCredentials(settings.CredentialsJSON); ok {
+			token, err = fetchExternalAccountToken(externalAccount, settings, taskSettings)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
+		} else if endpoints := resolveProviderEndpoints(taskSettings); endpoints != nil {
+			token, err = fetchProviderToken(endpoints, settings, taskSettings)
+			if err != nil {
+				fmt.Println(err)
+				return nil
+			}
 		} else {
 			token, err = sgauth.FetchToken(context.Background(), settings)
 			if err != nil {
@@ -164,7 +268,7 @@ func fetchToken(settings *sgauth.Settings, taskSettings *TaskSettings) *sgauth.T
 				return nil
 			}
 		}
-		err = InsertCache(settings, token)
+		err = InsertCache(cacheKeySettings(settings, taskSettings), token)
 		if err != nil {
 			fmt.Println(err)
 			return nil
@@ -181,8 +285,10 @@ func getCredentialType(settings *sgauth.Settings) string {
 	return cred.Type
 }
 
-// Prints the token with the specified format
-func printToken(token *sgauth.Token, format string, credType string) {
+// Prints the token with the specified format. provider is the identifier
+// of the non-Google provider the token was fetched from, or "" for the
+// Google default; it is only shown in the pretty format.
+func printToken(token *sgauth.Token, format string, credType string, provider string) {
 	if token != nil {
 		switch format {
 		case formatBare:
@@ -204,9 +310,16 @@ func printToken(token *sgauth.Token, format string, credType string) {
 			}
 			fmt.Println(string(json))
 		case formatPretty:
-			fmt.Printf("Fetched credentials of type:\n  %s\n"+
-				"Access Token:\n  %s\n",
-				credType, token.AccessToken)
+			if provider != "" {
+				fmt.Printf("Fetched credentials of type:\n  %s\n"+
+					"Provider:\n  %s\n"+
+					"Access Token:\n  %s\n",
+					credType, provider, token.AccessToken)
+			} else {
+				fmt.Printf("Fetched credentials of type:\n  %s\n"+
+					"Access Token:\n  %s\n",
+					credType, token.AccessToken)
+			}
 		default:
 			log.Fatalf("Invalid choice: '%s' "+
 				"(choose from 'bare', 'header', 'json', 'json_compact', 'pretty')",